@@ -11,10 +11,12 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
@@ -34,6 +36,22 @@ import (
 	"gopkg.in/ini.v1"
 )
 
+// countingCWClient wraps FakeCWClient's canned output behind a call
+// counter, so a test can prove the executor's GetMetricData cache
+// actually suppresses redundant AWS calls: FakeCWClient alone returns its
+// canned output regardless of how many times it's invoked, so asserting
+// only that two responses are equal would pass whether or not caching
+// ever ran.
+type countingCWClient struct {
+	cloudwatch.FakeCWClient
+	calls int32
+}
+
+func (c *countingCWClient) GetMetricDataWithContext(ctx aws.Context, input *cwapi.GetMetricDataInput, opts ...request.Option) (*cwapi.GetMetricDataOutput, error) {
+	atomic.AddInt32(&c.calls, 1)
+	return c.FakeCWClient.GetMetricDataWithContext(ctx, input, opts...)
+}
+
 func TestQueryCloudWatch_MetricFind(t *testing.T) {
 	const queryType = "metricFindQuery"
 	grafDir, cfgPath := createGrafDir(t)
@@ -267,6 +285,143 @@ func TestQueryCloudWatch_TimeSeries(t *testing.T) {
 			},
 		}, tr)
 	})
+
+	t.Run("Repeated identical requests are served from the GetMetricData cache", func(t *testing.T) {
+		t1 := time.Date(2020, 7, 7, 0, 0, 0, 0, time.UTC)
+		t2 := time.Date(2020, 7, 7, 23, 59, 59, 0, time.UTC)
+		counting := &countingCWClient{
+			FakeCWClient: cloudwatch.FakeCWClient{
+				MetricDataOutput: &cwapi.GetMetricDataOutput{
+					MetricDataResults: []*cwapi.MetricDataResult{
+						{
+							Id:         aws.String("queryid_stat1"),
+							Label:      aws.String("label"),
+							StatusCode: aws.String("Complete"),
+							Timestamps: []*time.Time{&t1, &t2},
+							Values:     []*float64{aws.Float64(1), aws.Float64(2)},
+						},
+					},
+				},
+			},
+		}
+		cloudwatch.NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+			return counting
+		}
+		t.Cleanup(func() {
+			cloudwatch.NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+				return client
+			}
+		})
+
+		req := dtos.MetricRequest{
+			From: t1.Format(time.RFC3339),
+			To:   t2.Format(time.RFC3339),
+			Queries: []*simplejson.Json{
+				simplejson.NewFromAny(map[string]interface{}{
+					"type":         queryType,
+					"subtype":      "metrics",
+					"region":       "us-east-1",
+					"namespace":    "custom",
+					"metricName":   "test",
+					"statistics":   []string{"stat1"},
+					"datasourceId": 1,
+					"refId":        "id",
+				}),
+			},
+		}
+
+		first := makeCWRequest(t, req, addr)
+		second := makeCWRequest(t, req, addr)
+		assert.Equal(t, first, second, "a back-to-back identical query should return the same cached result")
+		assert.EqualValues(t, 1, atomic.LoadInt32(&counting.calls),
+			"two identical requests should result in exactly one underlying GetMetricData call")
+	})
+
+	t.Run("dataGranularity rounds the requested period up and interpolates the response back down", func(t *testing.T) {
+		t1 := time.Date(2020, 7, 7, 0, 0, 0, 0, time.UTC)
+		t2 := time.Date(2020, 7, 7, 23, 59, 59, 0, time.UTC)
+		t3 := t1.Add(5 * time.Minute)
+		client = cloudwatch.FakeCWClient{
+			MetricDataOutput: &cwapi.GetMetricDataOutput{
+				MetricDataResults: []*cwapi.MetricDataResult{
+					{
+						Id:         aws.String("queryid_stat1"),
+						Label:      aws.String("label"),
+						StatusCode: aws.String("Complete"),
+						Timestamps: []*time.Time{&t1, &t3},
+						Values:     []*float64{aws.Float64(1), aws.Float64(2)},
+					},
+				},
+			},
+		}
+
+		req := dtos.MetricRequest{
+			From: t1.Format(time.RFC3339),
+			To:   t2.Format(time.RFC3339),
+			Queries: []*simplejson.Json{
+				simplejson.NewFromAny(map[string]interface{}{
+					"type":            queryType,
+					"subtype":         "metrics",
+					"region":          "us-east-1",
+					"namespace":       "custom",
+					"metricName":      "test",
+					"statistics":      []string{"stat1"},
+					"period":          "60",
+					"dataGranularity": 300,
+					"datasourceId":    1,
+					"refId":           "id",
+				}),
+			},
+		}
+
+		tr := makeCWRequest(t, req, addr)
+		require.Contains(t, tr.Results, "id")
+		// The two AWS datapoints are 300s apart; at the panel's 60s step
+		// that's interpolated into 6 points instead of the 2 CloudWatch
+		// actually returned.
+		require.Len(t, tr.Results["id"].Series, 1)
+		assert.Len(t, tr.Results["id"].Series[0].Points, 6)
+	})
+
+	t.Run("Metrics Insights query names its series after the result Label", func(t *testing.T) {
+		t1 := time.Date(2020, 7, 7, 0, 0, 0, 0, time.UTC)
+		t2 := time.Date(2020, 7, 7, 23, 59, 59, 0, time.UTC)
+		client = cloudwatch.FakeCWClient{
+			MetricDataOutput: &cwapi.GetMetricDataOutput{
+				MetricDataResults: []*cwapi.MetricDataResult{
+					{
+						Id:         aws.String("queryid_insights"),
+						Label:      aws.String("i-0123abcd my-asg"),
+						StatusCode: aws.String("Complete"),
+						Timestamps: []*time.Time{&t1, &t2},
+						Values:     []*float64{aws.Float64(1), aws.Float64(2)},
+					},
+				},
+			},
+		}
+
+		req := dtos.MetricRequest{
+			From: t1.Format(time.RFC3339),
+			To:   t2.Format(time.RFC3339),
+			Queries: []*simplejson.Json{
+				simplejson.NewFromAny(map[string]interface{}{
+					"type":         queryType,
+					"queryMode":    "insights",
+					"region":       "us-east-1",
+					"expression":   `SELECT AVG(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId, AutoScalingGroupName) GROUP BY InstanceId, AutoScalingGroupName LIMIT 10`,
+					"datasourceId": 1,
+					"refId":        "id",
+				}),
+			},
+		}
+
+		tr := makeCWRequest(t, req, addr)
+		require.Contains(t, tr.Results, "id")
+		require.Len(t, tr.Results["id"].Series, 1)
+		// An Insights query has no Alias, so the series is named after the
+		// raw result Label.
+		assert.Equal(t, "i-0123abcd my-asg", tr.Results["id"].Series[0].Name)
+	})
 }
 
 func makeCWRequest(t *testing.T, req dtos.MetricRequest, addr string) tsdb.Response {
@@ -0,0 +1,154 @@
+package cloudwatch
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+)
+
+// defaultQueryDeadline bounds how long a single panel's GetMetricData
+// batches are allowed to run for, derived from the incoming request's
+// context if that doesn't already carry a tighter deadline. It exists so
+// one slow region can't block a whole dashboard's other panels from
+// rendering.
+const defaultQueryDeadline = 30 * time.Second
+
+// metricDataBatchFunc executes one GetMetricData batch (a single call,
+// potentially paginated) against ctx, returning its output.
+type metricDataBatchFunc func(ctx context.Context) (*cloudwatch.GetMetricDataOutput, error)
+
+// withQueryDeadline derives a context bounded by the query's configured
+// soft deadline, unless the parent context already has a tighter one.
+func withQueryDeadline(parent context.Context, softDeadline time.Duration) (context.Context, context.CancelFunc) {
+	if softDeadline <= 0 {
+		softDeadline = defaultQueryDeadline
+	}
+	if deadline, ok := parent.Deadline(); ok && time.Until(deadline) < softDeadline {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, softDeadline)
+}
+
+// runMetricDataBatches runs each batch in order against ctx. If ctx's
+// deadline fires mid-run, outstanding AWS SDK calls are cancelled (the SDK
+// honors ctx on *WithContext calls); the interrupted batch and the
+// remaining, not-yet-started ones are counted as timed out and the latter
+// are not attempted. It never
+// returns an error: a batch that fails for a reason other than the
+// deadline is logged and skipped, since a partial panel beats a blank one.
+func runMetricDataBatches(ctx context.Context, logger *slog.Logger, batches []metricDataBatchFunc) (outputs []*cloudwatch.GetMetricDataOutput, framesTimedOut int) {
+	for i, batch := range batches {
+		select {
+		case <-ctx.Done():
+			framesTimedOut += len(batches) - i
+			logger.Debug("Query deadline already exceeded, skipping remaining batches",
+				slog.Int("remaining", len(batches)-i))
+			return outputs, framesTimedOut
+		default:
+		}
+
+		output, err := batch(ctx)
+		if err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				framesTimedOut += len(batches) - i
+				logger.Debug("Query deadline exceeded mid-batch", slog.Int("remaining", len(batches)-i))
+				return outputs, framesTimedOut
+			}
+			logger.Error("GetMetricData batch failed", slog.String("error", err.Error()))
+			continue
+		}
+		outputs = append(outputs, output)
+	}
+
+	return outputs, framesTimedOut
+}
+
+// annotatePartialResults marks every response as partial and records how
+// many batches didn't complete before the deadline fired, so the frontend
+// can render a "partial" badge on the affected panel instead of either
+// blanking it or silently showing incomplete data as if it were complete.
+func annotatePartialResults(responses []*cloudwatchResponse, framesTimedOut int) {
+	if framesTimedOut == 0 {
+		return
+	}
+	for _, r := range responses {
+		r.PartialData = true
+		r.DeadlineExceeded = true
+		r.FramesReturned = len(responses)
+		r.FramesTimedOut = framesTimedOut
+	}
+}
+
+// executeMetricDataBatches is the single entry point that turns a panel's
+// queries into cloudwatchResponses: streamingSource queries are served
+// straight from the Metric Streams buffer, regular metric stat queries go
+// through the shared metricDataCache so repeated/concurrent panels on the
+// same series share one GetMetricData call, and Insights queries are
+// fetched directly (their SQL result isn't cacheable the same way a plain
+// stat query is). All of this is bounded by softDeadline (withQueryDeadline's
+// default if zero); if the deadline fires mid-run, the responses of the
+// batches that did complete are marked partial via annotatePartialResults,
+// with FramesTimedOut counting the batches that did not. Those timed-out
+// batches' queries produce no response of their own.
+//
+// This is the one place a caller needs to hook in per-query-type dispatch
+// for a real timeSeriesQuery request; see deadline_test.go for coverage of
+// the deadline/streaming/cache paths cooperating on a single query set.
+func (e *cloudWatchExecutor) executeMetricDataBatches(parent context.Context, client cloudwatchiface.CloudWatchAPI,
+	queries map[string]*cloudWatchQuery, startTime, endTime time.Time, softDeadline time.Duration) ([]*cloudwatchResponse, error) {
+	ctx, cancel := withQueryDeadline(parent, softDeadline)
+	defer cancel()
+
+	ids := make([]string, 0, len(queries))
+	for id := range queries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	awsQueries := make(map[string]*cloudWatchQuery, len(ids))
+	streamingResponses := make([]*cloudwatchResponse, 0)
+	batches := make([]metricDataBatchFunc, 0, len(ids))
+	for _, id := range ids {
+		query := queries[id]
+		if query.StreamingSource {
+			streamingResponses = append(streamingResponses, e.streamingResponseFor(query))
+			continue
+		}
+
+		awsQueries[id] = query
+		if isInsightsQuery(query) {
+			batches = append(batches, func(ctx context.Context) (*cloudwatch.GetMetricDataOutput, error) {
+				input, err := e.buildMetricDataInput(query, startTime, endTime)
+				if err != nil {
+					return nil, err
+				}
+				return client.GetMetricDataWithContext(ctx, input)
+			})
+			continue
+		}
+
+		e.prepareTimeSeriesQuery(query)
+		batches = append(batches, func(ctx context.Context) (*cloudwatch.GetMetricDataOutput, error) {
+			result, err := e.getMetricDataWithCache(ctx, client, query, startTime, endTime, time.Now())
+			if err != nil {
+				return nil, err
+			}
+			return &cloudwatch.GetMetricDataOutput{MetricDataResults: []*cloudwatch.MetricDataResult{result}}, nil
+		})
+	}
+
+	outputs, framesTimedOut := runMetricDataBatches(ctx, e.logger(), batches)
+
+	responses, err := e.parseResponse(outputs, awsQueries)
+	if err != nil {
+		return nil, err
+	}
+
+	annotatePartialResults(responses, framesTimedOut)
+	return append(responses, streamingResponses...), nil
+}
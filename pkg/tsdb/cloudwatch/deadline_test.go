@@ -0,0 +1,166 @@
+package cloudwatch
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunMetricDataBatches_StopsAfterDeadlineAndCountsRemaining(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	var completed int
+	batches := []metricDataBatchFunc{
+		func(ctx context.Context) (*cloudwatch.GetMetricDataOutput, error) {
+			completed++
+			return &cloudwatch.GetMetricDataOutput{}, nil
+		},
+		func(ctx context.Context) (*cloudwatch.GetMetricDataOutput, error) {
+			<-ctx.Done()
+			completed++
+			return nil, ctx.Err()
+		},
+		func(ctx context.Context) (*cloudwatch.GetMetricDataOutput, error) {
+			completed++
+			return &cloudwatch.GetMetricDataOutput{}, nil
+		},
+	}
+
+	outputs, timedOut := runMetricDataBatches(ctx, logger, batches)
+
+	assert.Len(t, outputs, 1)
+	assert.Equal(t, 2, timedOut)
+}
+
+func TestRunMetricDataBatches_AllCompleteWithinDeadline(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	batches := []metricDataBatchFunc{
+		func(ctx context.Context) (*cloudwatch.GetMetricDataOutput, error) {
+			return &cloudwatch.GetMetricDataOutput{}, nil
+		},
+		func(ctx context.Context) (*cloudwatch.GetMetricDataOutput, error) {
+			return &cloudwatch.GetMetricDataOutput{}, nil
+		},
+	}
+
+	outputs, timedOut := runMetricDataBatches(ctx, logger, batches)
+
+	assert.Len(t, outputs, 2)
+	assert.Equal(t, 0, timedOut)
+}
+
+// blockingCWClient answers the first call immediately and blocks every
+// subsequent call until its context is cancelled, simulating a slow
+// region holding up the rest of a panel's batches.
+type blockingCWClient struct {
+	cloudwatchiface.CloudWatchAPI
+	calls int
+}
+
+func (c *blockingCWClient) GetMetricDataWithContext(ctx aws.Context, input *cloudwatch.GetMetricDataInput, _ ...request.Option) (*cloudwatch.GetMetricDataOutput, error) {
+	c.calls++
+	if c.calls == 1 {
+		id := input.MetricDataQueries[0].Id
+		return &cloudwatch.GetMetricDataOutput{
+			MetricDataResults: []*cloudwatch.MetricDataResult{
+				{Id: id, Label: aws.String("label"), StatusCode: aws.String("Complete")},
+			},
+		}, nil
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestExecuteMetricDataBatches_AnnotatesRealResponsesWhenDeadlineCutsBatchesShort(t *testing.T) {
+	client := &blockingCWClient{}
+	e := &cloudWatchExecutor{}
+	// Distinct metric names so the executor's GetMetricData cache (wired
+	// into this same code path) treats "a" and "b" as two different series
+	// instead of coalescing "b" into "a"'s cached result.
+	queries := map[string]*cloudWatchQuery{
+		"a": {Id: "a", RefId: "A", Namespace: "AWS/EC2", MetricName: "CPUUtilization", Stats: "Average", Period: 60},
+		"b": {Id: "b", RefId: "B", Namespace: "AWS/EC2", MetricName: "NetworkIn", Stats: "Average", Period: 60},
+	}
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	responses, err := e.executeMetricDataBatches(context.Background(), client, queries, start, end, 20*time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, responses, 1, "only the completed batch's query should have produced a response")
+
+	for _, r := range responses {
+		assert.True(t, r.PartialData)
+		assert.True(t, r.DeadlineExceeded)
+		assert.Equal(t, 1, r.FramesTimedOut)
+	}
+}
+
+func TestExecuteMetricDataBatches_DeadlineAppliesAcrossStreamingCacheAndAWSQueriesTogether(t *testing.T) {
+	client := &blockingCWClient{}
+	e := &cloudWatchExecutor{metricStreams: newMetricStreamStore("secret")}
+	dims := map[string][]string{"InstanceId": {"i-0123abcd"}}
+	e.metricStreams.bufferFor(streamBufferKey("AWS/EC2", "CPUUtilization", dims, "Sum")).add(streamPoint{
+		timestampMillis: 1_600_000_000_000,
+		value:           42,
+	})
+
+	// A mix of a streamingSource query (served from the buffer), a regular
+	// metric stat query (the one blockingCWClient answers before it starts
+	// blocking), and a second regular query (forced to block past the
+	// deadline) — proving the deadline, cache-aware batching, and
+	// streaming code paths all cooperate on one panel's query set rather
+	// than only being exercisable in isolation.
+	queries := map[string]*cloudWatchQuery{
+		"stream": {Id: "stream", RefId: "A", Namespace: "AWS/EC2", MetricName: "CPUUtilization",
+			Stats: "Sum", Dimensions: dims, StreamingSource: true},
+		"a": {Id: "a", RefId: "B", Namespace: "AWS/EC2", MetricName: "CPUUtilization", Stats: "Average", Period: 60},
+		"b": {Id: "b", RefId: "C", Namespace: "AWS/EC2", MetricName: "NetworkIn", Stats: "Average", Period: 60},
+	}
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	responses, err := e.executeMetricDataBatches(context.Background(), client, queries, start, end, 20*time.Millisecond)
+	require.NoError(t, err)
+
+	var sawStreamed, sawPartial bool
+	for _, r := range responses {
+		if r.RefId == "A" {
+			sawStreamed = true
+			assert.False(t, r.DeadlineExceeded, "a streamed response is served locally and never competes for the AWS deadline")
+		} else {
+			assert.True(t, r.PartialData)
+			assert.True(t, r.DeadlineExceeded)
+			sawPartial = true
+		}
+	}
+	assert.True(t, sawStreamed, "expected the streamingSource query's response in the result set")
+	assert.True(t, sawPartial, "expected the timed-out AWS query's response to be marked partial")
+}
+
+func TestAnnotatePartialResults(t *testing.T) {
+	responses := []*cloudwatchResponse{{RefId: "A"}, {RefId: "B"}}
+
+	annotatePartialResults(responses, 0)
+	assert.False(t, responses[0].DeadlineExceeded)
+
+	annotatePartialResults(responses, 3)
+	for _, r := range responses {
+		assert.True(t, r.PartialData)
+		assert.True(t, r.DeadlineExceeded)
+		assert.Equal(t, 3, r.FramesTimedOut)
+	}
+}
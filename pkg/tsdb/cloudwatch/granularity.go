@@ -0,0 +1,90 @@
+package cloudwatch
+
+// effectiveGranularityPeriod rounds requestedPeriod up to the nearest
+// multiple of dataGranularity seconds, so a single wider GetMetricData
+// query can be issued for the whole panel range instead of one at the
+// panel's native step. A dataGranularity of 0 disables the feature and
+// returns requestedPeriod unchanged.
+func effectiveGranularityPeriod(requestedPeriod, dataGranularity int) int {
+	if dataGranularity <= 0 {
+		return requestedPeriod
+	}
+	if requestedPeriod <= dataGranularity {
+		return dataGranularity
+	}
+	if remainder := requestedPeriod % dataGranularity; remainder != 0 {
+		return requestedPeriod + (dataGranularity - remainder)
+	}
+	return requestedPeriod
+}
+
+// prepareGranularityQuery applies dataGranularity to a query about to be
+// sent to GetMetricData. It stashes the panel's originally requested
+// period in PanelPeriod and rounds Period itself up to the configured
+// granularity, so the AWS request is issued at the coarse period while
+// parseGetMetricDataTimeSeries can later interpolate the response back
+// down to PanelPeriod. It's a no-op when DataGranularity is unset.
+func prepareGranularityQuery(query *cloudWatchQuery) {
+	if query.DataGranularity <= 0 {
+		return
+	}
+	query.PanelPeriod = query.Period
+	query.Period = effectiveGranularityPeriod(query.Period, query.DataGranularity)
+}
+
+// interpolateToStep takes a series sampled at fromPeriodMillis and
+// linearly interpolates it back down to toStepMillis so a dashboard
+// configured with dataGranularity still renders a dense series at the
+// panel's requested step. Trailing gaps (a nil value with no following
+// point) are forward-filled rather than interpolated. It is a no-op if
+// toStepMillis isn't strictly smaller than fromPeriodMillis.
+func interpolateToStep(timestamps []float64, values []*float64, fromPeriodMillis, toStepMillis int64) ([]float64, []*float64) {
+	if len(timestamps) == 0 || toStepMillis <= 0 || fromPeriodMillis <= 0 || toStepMillis >= fromPeriodMillis {
+		return timestamps, values
+	}
+
+	outTimestamps := make([]float64, 0, len(timestamps))
+	outValues := make([]*float64, 0, len(timestamps))
+
+	step := float64(toStepMillis)
+	for i := range timestamps {
+		outTimestamps = append(outTimestamps, timestamps[i])
+		outValues = append(outValues, values[i])
+
+		if i == len(timestamps)-1 || values[i] == nil {
+			continue
+		}
+
+		start, end := timestamps[i], timestamps[i+1]
+		startVal := *values[i]
+		endVal, haveEnd := 0.0, values[i+1] != nil
+		if haveEnd {
+			endVal = *values[i+1]
+		}
+
+		for t := start + step; t < end; t += step {
+			v := startVal
+			if haveEnd {
+				v = startVal + (t-start)/(end-start)*(endVal-startVal)
+			}
+			outTimestamps = append(outTimestamps, t)
+			outValues = append(outValues, &v)
+		}
+	}
+
+	return outTimestamps, outValues
+}
+
+// granularityMetaFor builds the Meta reported to the frontend describing
+// how much a dataGranularity query shrank the number of datapoints
+// actually requested from the CloudWatch API, compared to requesting the
+// panel's native step directly.
+func granularityMetaFor(effectivePeriod, apiDatapoints, denseDatapoints int) *dataGranularityMeta {
+	if apiDatapoints >= denseDatapoints || denseDatapoints == 0 {
+		return &dataGranularityMeta{EffectivePeriod: effectivePeriod}
+	}
+	return &dataGranularityMeta{
+		EffectivePeriod:      effectivePeriod,
+		DatapointsSavedRatio: 1 - float64(apiDatapoints)/float64(denseDatapoints),
+	}
+}
@@ -0,0 +1,74 @@
+package cloudwatch
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEffectiveGranularityPeriod(t *testing.T) {
+	assert.Equal(t, 60, effectiveGranularityPeriod(60, 0), "dataGranularity disabled leaves the period unchanged")
+	assert.Equal(t, 300, effectiveGranularityPeriod(60, 300), "a panel period finer than the granularity rounds up to it")
+	assert.Equal(t, 600, effectiveGranularityPeriod(301, 300), "a period just over a multiple rounds up to the next one")
+	assert.Equal(t, 600, effectiveGranularityPeriod(600, 300), "an exact multiple is left unchanged")
+}
+
+func TestPrepareGranularityQuery_RoundsPeriodUpAndStashesPanelPeriod(t *testing.T) {
+	query := &cloudWatchQuery{Period: 60, DataGranularity: 300}
+
+	e := &cloudWatchExecutor{}
+	e.prepareTimeSeriesQuery(query)
+
+	assert.Equal(t, 60, query.PanelPeriod, "the panel's original period must be preserved for later interpolation")
+	assert.Equal(t, 300, query.Period, "the period actually sent to GetMetricData must be rounded up to the granularity")
+}
+
+func TestParseGetMetricDataTimeSeries_InterpolatesGranularityResponseBackToPanelPeriod(t *testing.T) {
+	// Build the query the way a panel actually would: a 60s step widened to
+	// a 300s dataGranularity.
+	query := &cloudWatchQuery{
+		Namespace:       "AWS/EC2",
+		MetricName:      "CPUUtilization",
+		RefId:           "A",
+		Id:              "id",
+		Stats:           "Average",
+		Period:          60,
+		DataGranularity: 300,
+	}
+	e := &cloudWatchExecutor{}
+	e.prepareTimeSeriesQuery(query)
+	require.Equal(t, 300, query.Period, "GetMetricData must be called at the rounded-up granularity period")
+	require.Equal(t, 60, query.PanelPeriod)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	t1 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(5 * time.Minute)
+	results := map[string]*cloudwatch.MetricDataResult{
+		"label": {
+			StatusCode: aws.String("Complete"),
+			Timestamps: []*time.Time{&t1, &t2},
+			Values:     []*float64{aws.Float64(10), aws.Float64(20)},
+		},
+	}
+
+	frames, _, meta, err := parseGetMetricDataTimeSeries(logger, results, query)
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+
+	timestampField := frames[0].Fields[0]
+	valueField := frames[0].Fields[1]
+	// 300s apart at a 60s step means 4 extra interpolated points between
+	// the two AWS datapoints, for 6 total.
+	assert.Equal(t, 6, timestampField.Len())
+	assert.Equal(t, 6, valueField.Len())
+
+	require.NotNil(t, meta)
+	assert.Equal(t, 300, meta.EffectivePeriod)
+	assert.Greater(t, meta.DatapointsSavedRatio, 0.0)
+}
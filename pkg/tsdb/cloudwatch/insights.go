@@ -0,0 +1,132 @@
+package cloudwatch
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+// queryModeInsights is the requestQuery.QueryMode value that routes a
+// query through Metrics Insights instead of the namespace/metric/dimension
+// model: the query's Expression is a raw Metrics Insights SQL string and
+// is sent to GetMetricData as an Expression-only query, with no
+// MetricStat block.
+const queryModeInsights = "insights"
+
+func isInsightsQuery(query *cloudWatchQuery) bool {
+	return query.QueryMode == queryModeInsights
+}
+
+// maxInsightsLimit mirrors the CloudWatch Metrics Insights service-side
+// cap; we reject anything above it client-side so a typo doesn't burn a
+// GetMetricData call only to have AWS reject it.
+const maxInsightsLimit = 500
+
+// insightsAllowedFunctions are the aggregate functions Metrics Insights
+// supports in a SELECT clause.
+var insightsAllowedFunctions = map[string]bool{
+	"AVG":   true,
+	"COUNT": true,
+	"MAX":   true,
+	"MIN":   true,
+	"SUM":   true,
+}
+
+var (
+	insightsFunctionPattern = regexp.MustCompile(`(?i)\b([A-Z_]+)\s*\(`)
+	insightsLimitPattern    = regexp.MustCompile(`(?i)\bLIMIT\s+(\d+)\b`)
+	insightsGroupByPattern  = regexp.MustCompile(`(?i)\bGROUP\s+BY\s+(.+?)(\s+ORDER\s+BY\s+.+|\s+LIMIT\s+\d+|\s*)$`)
+)
+
+// validateInsightsQuery performs a lightweight, client-side sanity check
+// on a Metrics Insights SQL query before it's sent to GetMetricData:
+// it rejects a LIMIT above maxInsightsLimit and any SELECT function
+// outside the small set Metrics Insights actually supports.
+func validateInsightsQuery(sql string) error {
+	if strings.TrimSpace(sql) == "" {
+		return fmt.Errorf("insights query is empty")
+	}
+
+	if m := insightsLimitPattern.FindStringSubmatch(sql); m != nil {
+		limit, err := strconv.Atoi(m[1])
+		if err != nil {
+			return fmt.Errorf("invalid LIMIT clause %q: %w", m[1], err)
+		}
+		if limit > maxInsightsLimit {
+			return fmt.Errorf("LIMIT %d exceeds the maximum of %d supported by Metrics Insights", limit, maxInsightsLimit)
+		}
+	}
+
+	for _, m := range insightsFunctionPattern.FindAllStringSubmatch(sql, -1) {
+		fn := strings.ToUpper(m[1])
+		if fn == "SCHEMA" {
+			continue
+		}
+		if !insightsAllowedFunctions[fn] {
+			return fmt.Errorf("unsupported function %q in Metrics Insights query", fn)
+		}
+	}
+
+	return nil
+}
+
+// parseInsightsGroupByColumns extracts the column names listed in a
+// Metrics Insights query's GROUP BY clause, in order, so the space
+// separated values in each returned series' Label can be zipped back
+// into dimension tags.
+func parseInsightsGroupByColumns(sql string) []string {
+	m := insightsGroupByPattern.FindStringSubmatch(sql)
+	if m == nil {
+		return nil
+	}
+
+	columns := []string{}
+	for _, col := range strings.Split(m[1], ",") {
+		col = strings.Trim(strings.TrimSpace(col), `"`)
+		if col != "" {
+			columns = append(columns, col)
+		}
+	}
+	return columns
+}
+
+// buildInsightsMetricDataQuery validates query's Metrics Insights SQL and
+// builds the GetMetricData query for it. Unlike a regular metric stat
+// query, an Insights query is Expression-only: it carries no MetricStat
+// block, since CloudWatch itself resolves the SQL against the metric
+// namespace.
+func buildInsightsMetricDataQuery(query *cloudWatchQuery) (*cloudwatch.MetricDataQuery, error) {
+	if err := validateInsightsQuery(query.Expression); err != nil {
+		return nil, fmt.Errorf("invalid Metrics Insights query %q: %w", query.RefId, err)
+	}
+
+	return &cloudwatch.MetricDataQuery{
+		Id:         aws.String(query.Id),
+		Expression: aws.String(query.Expression),
+		ReturnData: aws.Bool(true),
+	}, nil
+}
+
+// insightsTagsFromLabel zips an Insights result Label (space-separated
+// dimension values, in GROUP BY order) with the GROUP BY column names to
+// produce the same kind of {dimension: value} tag map regular queries
+// derive from their Dimensions field.
+func insightsTagsFromLabel(groupByColumns []string, label string) map[string]string {
+	if len(groupByColumns) == 0 || label == "" {
+		return map[string]string{}
+	}
+
+	values := strings.Fields(label)
+	tags := make(map[string]string, len(groupByColumns))
+	for i, col := range groupByColumns {
+		if i >= len(values) {
+			break
+		}
+		tags[col] = values[i]
+	}
+	return tags
+}
@@ -0,0 +1,96 @@
+package cloudwatch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateInsightsQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		wantErr bool
+	}{
+		{
+			name: "valid query within the limit",
+			sql:  `SELECT AVG(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId) GROUP BY InstanceId LIMIT 10`,
+		},
+		{
+			name:    "limit above the maximum is rejected",
+			sql:     `SELECT AVG(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId) GROUP BY InstanceId LIMIT 501`,
+			wantErr: true,
+		},
+		{
+			name:    "unsupported function is rejected",
+			sql:     `SELECT STDDEV(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId) GROUP BY InstanceId LIMIT 10`,
+			wantErr: true,
+		},
+		{
+			name:    "empty query is rejected",
+			sql:     "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateInsightsQuery(tt.sql)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestParseInsightsGroupByColumns(t *testing.T) {
+	sql := `SELECT AVG(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId, AutoScalingGroupName) GROUP BY InstanceId, AutoScalingGroupName LIMIT 10`
+	assert.Equal(t, []string{"InstanceId", "AutoScalingGroupName"}, parseInsightsGroupByColumns(sql))
+
+	assert.Nil(t, parseInsightsGroupByColumns("SELECT AVG(CPUUtilization) FROM SCHEMA(\"AWS/EC2\")"))
+}
+
+func TestInsightsTagsFromLabel(t *testing.T) {
+	tags := insightsTagsFromLabel([]string{"InstanceId", "AutoScalingGroupName"}, "i-0123abcd my-asg")
+	assert.Equal(t, map[string]string{"InstanceId": "i-0123abcd", "AutoScalingGroupName": "my-asg"}, tags)
+
+	assert.Empty(t, insightsTagsFromLabel(nil, "i-0123abcd"))
+}
+
+func TestBuildInsightsMetricDataQuery_SendsExpressionOnlyWithNoMetricStat(t *testing.T) {
+	sql := `SELECT AVG(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId) GROUP BY InstanceId LIMIT 10`
+	query := &cloudWatchQuery{Id: "id", RefId: "A", QueryMode: queryModeInsights, Expression: sql}
+
+	dataQuery, err := buildInsightsMetricDataQuery(query)
+	require.NoError(t, err)
+	assert.Nil(t, dataQuery.MetricStat, "an Insights query must not carry a MetricStat block")
+	assert.Equal(t, sql, *dataQuery.Expression)
+	assert.Equal(t, "id", *dataQuery.Id)
+	assert.True(t, *dataQuery.ReturnData)
+}
+
+func TestBuildInsightsMetricDataQuery_RejectsInvalidSQL(t *testing.T) {
+	query := &cloudWatchQuery{Id: "id", RefId: "A", QueryMode: queryModeInsights,
+		Expression: `SELECT STDDEV(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId) GROUP BY InstanceId LIMIT 10`}
+
+	_, err := buildInsightsMetricDataQuery(query)
+	assert.Error(t, err, "an unsupported function should be rejected before ever reaching GetMetricData")
+}
+
+func TestBuildMetricDataInput_RoutesInsightsQueriesThroughBuildInsightsMetricDataQuery(t *testing.T) {
+	sql := `SELECT AVG(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId) GROUP BY InstanceId LIMIT 10`
+	query := &cloudWatchQuery{Id: "id", RefId: "A", QueryMode: queryModeInsights, Expression: sql}
+	e := &cloudWatchExecutor{}
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	input, err := e.buildMetricDataInput(query, start, end)
+	require.NoError(t, err)
+	require.Len(t, input.MetricDataQueries, 1)
+	assert.Nil(t, input.MetricDataQueries[0].MetricStat)
+	assert.Equal(t, sql, *input.MetricDataQueries[0].Expression)
+}
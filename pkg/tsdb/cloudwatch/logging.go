@@ -0,0 +1,97 @@
+package cloudwatch
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// newExecutorLogger builds the *slog.Logger a cloudWatchExecutor attaches
+// to itself: base wrapped in newDedupHandler so tight per-datapoint parse
+// loops don't flood debug output with repeated lines.
+func newExecutorLogger(base slog.Handler) *slog.Logger {
+	return slog.New(newDedupHandler(base))
+}
+
+// logger lazily initializes and returns the executor's slog.Logger, so
+// every call path can rely on e.logger() instead of touching the possibly
+// nil e.slog field directly.
+func (e *cloudWatchExecutor) logger() *slog.Logger {
+	if e.slog == nil {
+		e.slog = newExecutorLogger(slog.NewTextHandler(os.Stderr, nil))
+	}
+	return e.slog
+}
+
+// correlationID returns a short, request-scoped identifier that's attached
+// to every slog line emitted while handling a single query, so all the log
+// output for one panel/query can be grep'd together.
+func correlationID() string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// queryLogger returns a logger carrying a "corrId" attribute derived from
+// refID, plus the refID itself, for use throughout a single query's
+// execution.
+func queryLogger(base *slog.Logger, refID string) *slog.Logger {
+	return base.With(slog.String("refId", refID), slog.String("corrId", refID+"-"+correlationID()))
+}
+
+// dedupWindow is how long an identical (level, message) pair is
+// suppressed for after first being logged, to keep tight parse loops from
+// flooding debug output with repeats.
+const dedupWindow = 2 * time.Second
+
+// dedupHandler wraps an slog.Handler and drops records whose level and
+// message exactly match one already emitted within dedupWindow, so
+// debug-level logging stays usable even inside per-datapoint parse loops.
+type dedupHandler struct {
+	next slog.Handler
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// newDedupHandler wraps next so repeated identical messages are
+// suppressed within dedupWindow.
+func newDedupHandler(next slog.Handler) *dedupHandler {
+	return &dedupHandler{next: next, seen: make(map[string]time.Time)}
+}
+
+func (h *dedupHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *dedupHandler) Handle(ctx context.Context, r slog.Record) error {
+	key := r.Level.String() + "|" + r.Message
+
+	h.mu.Lock()
+	now := time.Now()
+	if last, seen := h.seen[key]; seen && now.Sub(last) < dedupWindow {
+		h.mu.Unlock()
+		return nil
+	}
+	h.seen[key] = now
+	h.mu.Unlock()
+
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs gives the derived handler its own seen map rather than sharing
+// h's. queryLogger calls this to attach a per-query corrId, and those
+// per-query loggers run concurrently — sharing one seen map would let a
+// message logged for one query suppress the identical message logged for
+// another, defeating the point of the corrId scoping in the first place.
+func (h *dedupHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &dedupHandler{next: h.next.WithAttrs(attrs), seen: make(map[string]time.Time)}
+}
+
+func (h *dedupHandler) WithGroup(name string) slog.Handler {
+	return &dedupHandler{next: h.next.WithGroup(name), seen: make(map[string]time.Time)}
+}
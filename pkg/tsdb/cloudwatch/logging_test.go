@@ -0,0 +1,49 @@
+package cloudwatch
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupHandler_SuppressesRepeatedMessagesWithinWindow(t *testing.T) {
+	var buf bytes.Buffer
+	handler := newDedupHandler(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	logger := slog.New(handler)
+
+	for i := 0; i < 5; i++ {
+		logger.Debug("Handling timestamp", slog.Int("i", i))
+	}
+	logger.Debug("a different message")
+
+	output := buf.String()
+	assert.Equal(t, 1, strings.Count(output, "Handling timestamp"), "repeated identical messages should be deduplicated")
+	assert.Equal(t, 1, strings.Count(output, "a different message"))
+}
+
+func TestQueryLogger_DoesNotSuppressIdenticalMessagesAcrossDifferentQueries(t *testing.T) {
+	var buf bytes.Buffer
+	base := slog.New(newDedupHandler(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	queryLogger(base, "A").Debug("Handling timestamp")
+	queryLogger(base, "B").Debug("Handling timestamp")
+
+	output := buf.String()
+	assert.Equal(t, 2, strings.Count(output, "Handling timestamp"),
+		"the same literal message from two different queries must not suppress one another")
+}
+
+func TestQueryLogger_AttachesRefIdAndCorrelationID(t *testing.T) {
+	var buf bytes.Buffer
+	base := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	logger := queryLogger(base, "A")
+	logger.Debug("test message")
+
+	output := buf.String()
+	assert.Contains(t, output, `refId=A`)
+	assert.Contains(t, output, "corrId=A-")
+}
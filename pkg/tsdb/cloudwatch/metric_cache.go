@@ -0,0 +1,177 @@
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"golang.org/x/sync/singleflight"
+)
+
+// metricDataCacheTTL is how long a completed, non-trailing window is kept.
+// Historical data for a metric never changes once the window has fully
+// elapsed, so this can be generous.
+const metricDataCacheTTL = 1 * time.Hour
+
+// metricDataCache sits in front of GetMetricData. It's keyed on everything
+// that affects the result (region, namespace, metric, dimensions, stat,
+// period and the query's aligned time range) and coalesces concurrent
+// identical requests with singleflight, so a dashboard with many panels
+// sharing the same metric only issues one AWS API call per unique series.
+type metricDataCache struct {
+	mu      sync.Mutex
+	entries map[string]metricDataCacheEntry
+
+	group singleflight.Group
+}
+
+type metricDataCacheEntry struct {
+	result    *cloudwatch.MetricDataResult
+	expiresAt time.Time
+}
+
+func newMetricDataCache() *metricDataCache {
+	return &metricDataCache{entries: make(map[string]metricDataCacheEntry)}
+}
+
+// metricDataCacheKey builds the cache key for a single metric stat query,
+// aligning endTime down to a period boundary so that requests differing
+// only by sub-period jitter in "now" still share a cache entry.
+func metricDataCacheKey(region, namespace, metricName string, dimensions map[string][]string, stat string, period int, startTime, endTime time.Time) string {
+	alignedEnd := endTime
+	if period > 0 {
+		alignedEnd = time.Unix(endTime.Unix()/int64(period)*int64(period), 0).UTC()
+	}
+
+	dimKeys := make([]string, 0, len(dimensions))
+	for k, v := range dimensions {
+		dimKeys = append(dimKeys, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(dimKeys)
+
+	return fmt.Sprintf("%s|%s|%s|%v|%s|%d|%d|%d",
+		region, namespace, metricName, dimKeys, stat, period, startTime.Unix(), alignedEnd.Unix())
+}
+
+// isTrailingWindow reports whether a query's end time falls within the
+// current, still-accumulating period, meaning CloudWatch may still revise
+// the datapoint and it must not be cached for long.
+func isTrailingWindow(endTime time.Time, period int, now time.Time) bool {
+	if period <= 0 {
+		return true
+	}
+	return endTime.After(now.Add(-time.Duration(period) * time.Second))
+}
+
+// getOrFetch returns the cached MetricDataResult for key if present and
+// unexpired, otherwise calls fetch to populate it. Concurrent calls for
+// the same key are coalesced so fetch runs at most once at a time.
+func (c *metricDataCache) getOrFetch(key string, period int, endTime time.Time, now time.Time,
+	fetch func() (*cloudwatch.MetricDataResult, error)) (*cloudwatch.MetricDataResult, error) {
+	c.mu.Lock()
+	if entry, exists := c.entries[key]; exists && now.Before(entry.expiresAt) {
+		c.mu.Unlock()
+		return entry.result, nil
+	}
+	c.mu.Unlock()
+
+	v, err, _ := c.group.Do(key, func() (interface{}, error) {
+		result, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+
+		ttl := metricDataCacheTTL
+		if isTrailingWindow(endTime, period, now) {
+			// Cache only until the next period boundary elapses, since the
+			// current, still-accumulating datapoint may still change.
+			ttl = time.Second
+			if period > 0 {
+				p := int64(period)
+				ttl = time.Unix((now.Unix()/p+1)*p, 0).Sub(now)
+			}
+		}
+
+		c.mu.Lock()
+		c.entries[key] = metricDataCacheEntry{result: result, expiresAt: now.Add(ttl)}
+		c.mu.Unlock()
+
+		return result, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*cloudwatch.MetricDataResult), nil
+}
+
+// cache lazily initializes and returns the executor's shared
+// metricDataCache, mirroring the e.logger() lazy-init pattern so callers
+// can rely on e.cache() instead of touching the possibly nil
+// e.metricCache field directly.
+func (e *cloudWatchExecutor) cache() *metricDataCache {
+	if e.metricCache == nil {
+		e.metricCache = newMetricDataCache()
+	}
+	return e.metricCache
+}
+
+// buildGetMetricDataInput builds the single-query GetMetricDataInput for a
+// regular (non-Insights) metric stat query.
+func buildGetMetricDataInput(query *cloudWatchQuery, startTime, endTime time.Time) *cloudwatch.GetMetricDataInput {
+	dims := make([]*cloudwatch.Dimension, 0, len(query.Dimensions))
+	for name, values := range query.Dimensions {
+		if len(values) == 0 {
+			continue
+		}
+		dims = append(dims, &cloudwatch.Dimension{Name: aws.String(name), Value: aws.String(values[0])})
+	}
+
+	return &cloudwatch.GetMetricDataInput{
+		StartTime: aws.Time(startTime),
+		EndTime:   aws.Time(endTime),
+		MetricDataQueries: []*cloudwatch.MetricDataQuery{
+			{
+				Id:         aws.String(query.Id),
+				ReturnData: aws.Bool(true),
+				MetricStat: &cloudwatch.MetricStat{
+					Metric: &cloudwatch.Metric{
+						Namespace:  aws.String(query.Namespace),
+						MetricName: aws.String(query.MetricName),
+						Dimensions: dims,
+					},
+					Period: aws.Int64(int64(query.Period)),
+					Stat:   aws.String(query.Stats),
+				},
+			},
+		},
+	}
+}
+
+// getMetricDataWithCache fetches a single metric stat query's datapoints
+// through the executor's shared metricDataCache, so repeated or
+// concurrent panels requesting the exact same series (same region,
+// namespace, metric, dimensions, stat, period and aligned time range)
+// only issue one GetMetricData call against client.
+func (e *cloudWatchExecutor) getMetricDataWithCache(ctx context.Context, client cloudwatchiface.CloudWatchAPI,
+	query *cloudWatchQuery, startTime, endTime, now time.Time) (*cloudwatch.MetricDataResult, error) {
+	key := metricDataCacheKey(query.Region, query.Namespace, query.MetricName, query.Dimensions, query.Stats, query.Period, startTime, endTime)
+
+	return e.cache().getOrFetch(key, query.Period, endTime, now, func() (*cloudwatch.MetricDataResult, error) {
+		output, err := client.GetMetricDataWithContext(ctx, buildGetMetricDataInput(query, startTime, endTime))
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range output.MetricDataResults {
+			if r.Id != nil && *r.Id == query.Id {
+				return r, nil
+			}
+		}
+		return nil, fmt.Errorf("no result for query %q in GetMetricData response", query.Id)
+	})
+}
@@ -0,0 +1,123 @@
+package cloudwatch
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingCWClient is a minimal cloudwatchiface.CloudWatchAPI stub that
+// counts GetMetricDataWithContext invocations, so a test can prove the
+// executor's cache actually suppresses redundant AWS calls rather than
+// just asserting two identical-looking results (which a deterministic
+// stub would return regardless of how many times it's called).
+type countingCWClient struct {
+	cloudwatchiface.CloudWatchAPI
+	calls  int32
+	output *cloudwatch.GetMetricDataOutput
+}
+
+func (c *countingCWClient) GetMetricDataWithContext(_ aws.Context, _ *cloudwatch.GetMetricDataInput, _ ...request.Option) (*cloudwatch.GetMetricDataOutput, error) {
+	atomic.AddInt32(&c.calls, 1)
+	return c.output, nil
+}
+
+func TestGetMetricDataWithCache_CoalescesRepeatedIdenticalQueries(t *testing.T) {
+	client := &countingCWClient{
+		output: &cloudwatch.GetMetricDataOutput{
+			MetricDataResults: []*cloudwatch.MetricDataResult{
+				{Id: aws.String("id"), Label: aws.String("label"), StatusCode: aws.String("Complete")},
+			},
+		},
+	}
+	e := &cloudWatchExecutor{}
+	query := &cloudWatchQuery{
+		Id: "id", Region: "us-east-1", Namespace: "AWS/EC2", MetricName: "CPUUtilization",
+		Dimensions: map[string][]string{"InstanceId": {"i-123"}}, Stats: "Average", Period: 300,
+	}
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	start, end := now.Add(-time.Hour), now.Add(-10*time.Minute)
+
+	for i := 0; i < 5; i++ {
+		_, err := e.getMetricDataWithCache(context.Background(), client, query, start, end, now)
+		require.NoError(t, err)
+	}
+
+	assert.EqualValues(t, 1, atomic.LoadInt32(&client.calls), "five identical requests should result in exactly one GetMetricData call")
+}
+
+func TestMetricDataCache_CoalescesConcurrentIdenticalRequests(t *testing.T) {
+	cache := newMetricDataCache()
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	key := metricDataCacheKey("us-east-1", "AWS/EC2", "CPUUtilization",
+		map[string][]string{"InstanceId": {"i-123"}}, "Average", 300,
+		now.Add(-time.Hour), now.Add(-5*time.Minute))
+
+	var calls int32
+	fetch := func() (*cloudwatch.MetricDataResult, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return &cloudwatch.MetricDataResult{}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cache.getOrFetch(key, 300, now.Add(-5*time.Minute), now, fetch)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls), "expected all concurrent identical requests to be coalesced into one AWS call")
+}
+
+func TestMetricDataCache_ServesFromCacheUntilTTLExpires(t *testing.T) {
+	cache := newMetricDataCache()
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	// Fully elapsed window: should get the long TTL, not the trailing one.
+	key := metricDataCacheKey("us-east-1", "AWS/EC2", "CPUUtilization", nil, "Average", 300,
+		now.Add(-time.Hour), now.Add(-10*time.Minute))
+
+	var calls int32
+	fetch := func() (*cloudwatch.MetricDataResult, error) {
+		atomic.AddInt32(&calls, 1)
+		return &cloudwatch.MetricDataResult{}, nil
+	}
+
+	_, err := cache.getOrFetch(key, 300, now.Add(-10*time.Minute), now, fetch)
+	require.NoError(t, err)
+	_, err = cache.getOrFetch(key, 300, now.Add(-10*time.Minute), now, fetch)
+	require.NoError(t, err)
+
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls), "second lookup should be served from cache")
+}
+
+func TestMetricDataCacheKey_IsDeterministicRegardlessOfDimensionMapIterationOrder(t *testing.T) {
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	dims := map[string][]string{"InstanceId": {"i-1"}, "AutoScalingGroupName": {"asg-1"}, "AvailabilityZone": {"us-east-1a"}}
+
+	want := metricDataCacheKey("us-east-1", "AWS/EC2", "CPUUtilization", dims, "Average", 300, now.Add(-time.Hour), now)
+	for i := 0; i < 50; i++ {
+		got := metricDataCacheKey("us-east-1", "AWS/EC2", "CPUUtilization", dims, "Average", 300, now.Add(-time.Hour), now)
+		assert.Equal(t, want, got, "the key must not depend on Go's randomized map iteration order")
+	}
+}
+
+func TestIsTrailingWindow(t *testing.T) {
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.True(t, isTrailingWindow(now.Add(-30*time.Second), 300, now), "end time within the last period should be trailing")
+	assert.False(t, isTrailingWindow(now.Add(-10*time.Minute), 300, now), "end time well in the past should not be trailing")
+}
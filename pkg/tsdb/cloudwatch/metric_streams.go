@@ -0,0 +1,394 @@
+package cloudwatch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gogo/protobuf/proto"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// firehoseAccessKeyHeader is the header Kinesis Data Firehose sets on every
+// HTTP endpoint delivery request, carrying the access key configured on the
+// Firehose delivery stream. We compare it against the per-datasource secret
+// to authenticate deliveries.
+const firehoseAccessKeyHeader = "X-Amz-Firehose-Access-Key"
+
+// streamPoint is a single datapoint ingested from a Metric Streams delivery.
+type streamPoint struct {
+	timestampMillis int64
+	value           float64
+}
+
+// streamBufferSize caps the number of datapoints retained per series so the
+// in-memory ring can't grow unbounded for high-frequency metrics.
+const streamBufferSize = 720 // 1 hour of data at a 5s Metric Streams cadence
+
+// metricStreamRing is a fixed-size ring buffer of the most recent datapoints
+// for a single namespace/metric/dimensions/stat series.
+type metricStreamRing struct {
+	mu     sync.Mutex
+	points []streamPoint
+}
+
+func newMetricStreamRing() *metricStreamRing {
+	return &metricStreamRing{points: make([]streamPoint, 0, streamBufferSize)}
+}
+
+func (r *metricStreamRing) add(p streamPoint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.points = append(r.points, p)
+	if len(r.points) > streamBufferSize {
+		r.points = r.points[len(r.points)-streamBufferSize:]
+	}
+}
+
+func (r *metricStreamRing) snapshot() []streamPoint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]streamPoint, len(r.points))
+	copy(out, r.points)
+	return out
+}
+
+// metricStreamStore holds a datasource's ring buffers, one per series keyed
+// by "namespace|metric|dims|stat", plus the shared secret used to
+// authenticate Firehose deliveries for that datasource.
+type metricStreamStore struct {
+	mu      sync.RWMutex
+	secret  string
+	buffers map[string]*metricStreamRing
+}
+
+func newMetricStreamStore(secret string) *metricStreamStore {
+	return &metricStreamStore{
+		secret:  secret,
+		buffers: make(map[string]*metricStreamRing),
+	}
+}
+
+func (s *metricStreamStore) bufferFor(key string) *metricStreamRing {
+	s.mu.RLock()
+	ring, exists := s.buffers[key]
+	s.mu.RUnlock()
+	if exists {
+		return ring
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ring, exists = s.buffers[key]; exists {
+		return ring
+	}
+	ring = newMetricStreamRing()
+	s.buffers[key] = ring
+	return ring
+}
+
+// queryStreamingBuffer returns buffered datapoints for the given query as a
+// data.Frame, for use by the timeSeriesQuery path when a query is marked
+// with streamingSource: true. It returns nil if nothing has been ingested
+// for this series yet.
+func (e *cloudWatchExecutor) queryStreamingBuffer(query *cloudWatchQuery) *data.Frame {
+	store := e.metricStreams
+	if store == nil {
+		return nil
+	}
+
+	key := streamBufferKey(query.Namespace, query.MetricName, query.Dimensions, query.Stats)
+	store.mu.RLock()
+	ring, exists := store.buffers[key]
+	store.mu.RUnlock()
+	if !exists {
+		return nil
+	}
+
+	points := ring.snapshot()
+	timestamps := make([]float64, len(points))
+	values := make([]*float64, len(points))
+	for i, p := range points {
+		timestamps[i] = float64(p.timestampMillis)
+		v := p.value
+		values[i] = &v
+	}
+
+	tags := map[string]string{}
+	for k, v := range query.Dimensions {
+		if len(v) > 0 {
+			tags[k] = v[0]
+		}
+	}
+
+	return &data.Frame{
+		Name: formatAlias(e.logger(), query, query.Stats, tags, ""),
+		Fields: []*data.Field{
+			data.NewField("timestamp", nil, timestamps),
+			data.NewField("value", nil, values),
+		},
+		Meta: &data.FrameMeta{
+			Custom: map[string]interface{}{
+				"tags":            tags,
+				"streamingSource": true,
+			},
+		},
+	}
+}
+
+func streamBufferKey(namespace, metricName string, dimensions map[string][]string, stat string) string {
+	dimKeys := make([]string, 0, len(dimensions))
+	for k, v := range dimensions {
+		if len(v) > 0 {
+			dimKeys = append(dimKeys, k+"="+v[0])
+		}
+	}
+	sort.Strings(dimKeys)
+	return fmt.Sprintf("%s|%s|%s|%s", namespace, metricName, strings.Join(dimKeys, ","), stat)
+}
+
+// streamingResponseFor serves a streamingSource: true query directly from
+// the Metric Streams ring buffer instead of calling GetMetricData, since
+// the data was already pushed to us by a Firehose delivery rather than
+// needing to be pulled from the CloudWatch API.
+func (e *cloudWatchExecutor) streamingResponseFor(query *cloudWatchQuery) *cloudwatchResponse {
+	frames := data.Frames{}
+	if frame := e.queryStreamingBuffer(query); frame != nil {
+		frames = data.Frames{frame}
+	}
+	return &cloudwatchResponse{
+		DataFrames: frames,
+		Period:     query.Period,
+		RefId:      query.RefId,
+		Id:         query.Id,
+	}
+}
+
+// firehoseRequest is the envelope Kinesis Data Firehose POSTs to HTTP
+// endpoint destinations. See AWS's "HTTP Endpoint Delivery Request and
+// Response Specification".
+type firehoseRequest struct {
+	RequestID string `json:"requestId"`
+	Timestamp int64  `json:"timestamp"`
+	Records   []struct {
+		Data string `json:"data"`
+	} `json:"records"`
+}
+
+type firehoseResponse struct {
+	RequestID    string `json:"requestId"`
+	Timestamp    int64  `json:"timestamp"`
+	ErrorMessage string `json:"errorMessage,omitempty"`
+}
+
+// MetricStreamsHandler returns an http.Handler that accepts CloudWatch
+// Metric Streams deliveries pushed by a Kinesis Data Firehose HTTP endpoint
+// destination in the OpenTelemetry 1.0 protobuf output format
+// (https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/cloudwatch-metric-streams-formats-opentelemetry.html).
+func (e *cloudWatchExecutor) MetricStreamsHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		e.handleMetricStreamsDelivery(rw, req)
+	})
+}
+
+// RegisterMetricStreamsRoute mounts the Metric Streams Firehose endpoint at
+// pattern on mux, alongside the datasource's other query routes, so each
+// datasource instance can expose its own ingestion URL backed by its own
+// Firehose access-key secret.
+func (e *cloudWatchExecutor) RegisterMetricStreamsRoute(mux *http.ServeMux, pattern string) {
+	mux.Handle(pattern, e.MetricStreamsHandler())
+}
+
+func (e *cloudWatchExecutor) handleMetricStreamsDelivery(rw http.ResponseWriter, req *http.Request) {
+	logger := e.logger()
+	store := e.metricStreams
+	if store == nil {
+		http.Error(rw, "metric streams ingestion is not configured for this datasource", http.StatusNotFound)
+		return
+	}
+
+	providedKey := req.Header.Get(firehoseAccessKeyHeader)
+	if subtle.ConstantTimeCompare([]byte(providedKey), []byte(store.secret)) != 1 {
+		logger.Debug("Rejecting metric stream delivery with invalid access key")
+		http.Error(rw, "invalid "+firehoseAccessKeyHeader, http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("failed to read request body: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var fr firehoseRequest
+	if err := json.Unmarshal(body, &fr); err != nil {
+		http.Error(rw, fmt.Sprintf("failed to decode firehose request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	recordsIngested := 0
+	recordsFailed := 0
+	var lastErr error
+	for _, record := range fr.Records {
+		n, err := e.ingestFirehoseRecord(record.Data)
+		if err != nil {
+			logger.Error("Failed to ingest metric stream record", slog.String("error", err.Error()))
+			recordsFailed++
+			lastErr = err
+			continue
+		}
+		recordsIngested += n
+	}
+	logger.Debug("Ingested metric stream delivery", slog.String("requestId", fr.RequestID),
+		slog.Int("datapoints", recordsIngested), slog.Int("recordsFailed", recordsFailed))
+
+	// Firehose retries the whole delivery whenever we respond with
+	// anything other than 200, so only do that when every record in the
+	// delivery failed to decode - a partial failure (one malformed record
+	// among many good ones) should be acked so the good records aren't
+	// redelivered forever alongside the bad one.
+	if len(fr.Records) > 0 && recordsFailed == len(fr.Records) {
+		resp := firehoseResponse{
+			RequestID:    fr.RequestID,
+			Timestamp:    fr.Timestamp,
+			ErrorMessage: fmt.Sprintf("failed to ingest all %d record(s): %s", recordsFailed, lastErr),
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(rw).Encode(resp)
+		return
+	}
+
+	resp := firehoseResponse{RequestID: fr.RequestID, Timestamp: fr.Timestamp}
+	if recordsFailed > 0 {
+		resp.ErrorMessage = fmt.Sprintf("%d of %d record(s) failed to ingest: %s", recordsFailed, len(fr.Records), lastErr)
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(rw).Encode(resp)
+}
+
+// ingestFirehoseRecord decodes a single base64/gzip Firehose record
+// containing an OTLP ExportMetricsServiceRequest and buffers every
+// Sum/Gauge/Histogram datapoint it contains. It returns the number of
+// datapoints buffered.
+func (e *cloudWatchExecutor) ingestFirehoseRecord(b64Data string) (int, error) {
+	raw, err := base64.StdEncoding.DecodeString(b64Data)
+	if err != nil {
+		return 0, fmt.Errorf("decoding base64 record: %w", err)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return 0, fmt.Errorf("decompressing record: %w", err)
+	}
+	defer gz.Close()
+
+	decompressed, err := io.ReadAll(gz)
+	if err != nil {
+		return 0, fmt.Errorf("reading decompressed record: %w", err)
+	}
+
+	var otlpReq colmetricpb.ExportMetricsServiceRequest
+	if err := proto.Unmarshal(decompressed, &otlpReq); err != nil {
+		return 0, fmt.Errorf("unmarshalling OTLP metrics payload: %w", err)
+	}
+
+	ingested := 0
+	for _, rm := range otlpReq.ResourceMetrics {
+		namespace, resourceDims := resourceAttributesToDimensions(rm)
+		for _, ilm := range rm.InstrumentationLibraryMetrics {
+			for _, m := range ilm.Metrics {
+				ingested += e.bufferOTLPMetric(namespace, m, resourceDims)
+			}
+		}
+	}
+	return ingested, nil
+}
+
+func resourceAttributesToDimensions(rm *metricpb.ResourceMetrics) (string, map[string][]string) {
+	namespace := ""
+	dims := map[string][]string{}
+	if rm.Resource == nil {
+		return namespace, dims
+	}
+	for _, attr := range rm.Resource.Attributes {
+		switch attr.Key {
+		case "aws.cloudwatch.namespace", "cloudwatch.namespace":
+			namespace = attr.Value.GetStringValue()
+		default:
+			dims[attr.Key] = []string{attr.Value.GetStringValue()}
+		}
+	}
+	return namespace, dims
+}
+
+// bufferOTLPMetric translates one OTLP metric's Sum/Gauge/Histogram
+// datapoints into the stat-keyed ring buffers ("Sum", "SampleCount", "Min",
+// "Max" for histograms; "Sum" for sums; "Average" for gauges) and returns how many
+// datapoints were buffered.
+func (e *cloudWatchExecutor) bufferOTLPMetric(namespace string, m *metricpb.Metric, resourceDims map[string][]string) int {
+	ingested := 0
+
+	bufferDatapoint := func(stat string, dims map[string][]string, timestampUnixNano uint64, value float64) {
+		merged := map[string][]string{}
+		for k, v := range resourceDims {
+			merged[k] = v
+		}
+		for k, v := range dims {
+			merged[k] = v
+		}
+		key := streamBufferKey(namespace, m.Name, merged, stat)
+		e.metricStreams.bufferFor(key).add(streamPoint{
+			timestampMillis: int64(timestampUnixNano / 1e6),
+			value:           value,
+		})
+		ingested++
+	}
+
+	if sum := m.GetSum(); sum != nil {
+		for _, dp := range sum.DataPoints {
+			bufferDatapoint("Sum", otlpAttrsToDimensions(dp.Attributes), dp.TimeUnixNano, dp.Value)
+		}
+	}
+	if gauge := m.GetGauge(); gauge != nil {
+		for _, dp := range gauge.DataPoints {
+			bufferDatapoint("Average", otlpAttrsToDimensions(dp.Attributes), dp.TimeUnixNano, dp.Value)
+		}
+	}
+	if hist := m.GetHistogram(); hist != nil {
+		for _, dp := range hist.DataPoints {
+			dims := otlpAttrsToDimensions(dp.Attributes)
+			bufferDatapoint("SampleCount", dims, dp.TimeUnixNano, float64(dp.Count))
+			bufferDatapoint("Sum", dims, dp.TimeUnixNano, dp.Sum)
+			if dp.Min != nil {
+				bufferDatapoint("Min", dims, dp.TimeUnixNano, *dp.Min)
+			}
+			if dp.Max != nil {
+				bufferDatapoint("Max", dims, dp.TimeUnixNano, *dp.Max)
+			}
+		}
+	}
+
+	return ingested
+}
+
+func otlpAttrsToDimensions(attrs []*metricpb.KeyValue) map[string][]string {
+	dims := make(map[string][]string, len(attrs))
+	for _, attr := range attrs {
+		dims[attr.Key] = []string{attr.Value.GetStringValue()}
+	}
+	return dims
+}
@@ -0,0 +1,193 @@
+package cloudwatch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+func newTestMetricStreamsExecutor(secret string) *cloudWatchExecutor {
+	return &cloudWatchExecutor{metricStreams: newMetricStreamStore(secret)}
+}
+
+func encodeFirehoseRecord(t *testing.T, otlpReq *colmetricpb.ExportMetricsServiceRequest) string {
+	t.Helper()
+
+	raw, err := proto.Marshal(otlpReq)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err = gz.Write(raw)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestMetricStreamsHandler_RejectsInvalidAccessKey(t *testing.T) {
+	e := newTestMetricStreamsExecutor("correct-secret")
+	srv := httptest.NewServer(e.MetricStreamsHandler())
+	defer srv.Close()
+
+	body, err := json.Marshal(firehoseRequest{RequestID: "r1"})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set(firehoseAccessKeyHeader, "wrong-secret")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestMetricStreamsHandler_RejectsMalformedRecordButAcksGoodOnes(t *testing.T) {
+	e := newTestMetricStreamsExecutor("correct-secret")
+	srv := httptest.NewServer(e.MetricStreamsHandler())
+	defer srv.Close()
+
+	goodRecord := encodeFirehoseRecord(t, &colmetricpb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricpb.ResourceMetrics{
+			{
+				Resource: &metricpb.Resource{
+					Attributes: []*metricpb.KeyValue{
+						{Key: "aws.cloudwatch.namespace", Value: &metricpb.AnyValue{Value: &metricpb.AnyValue_StringValue{StringValue: "AWS/EC2"}}},
+						{Key: "InstanceId", Value: &metricpb.AnyValue{Value: &metricpb.AnyValue_StringValue{StringValue: "i-0123abcd"}}},
+					},
+				},
+				InstrumentationLibraryMetrics: []*metricpb.InstrumentationLibraryMetrics{
+					{
+						Metrics: []*metricpb.Metric{
+							{
+								Name: "CPUUtilization",
+								Data: &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+									DataPoints: []*metricpb.NumberDataPoint{
+										{TimeUnixNano: 1_600_000_000_000_000_000, Value: 42},
+									},
+								}},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	body, err := json.Marshal(firehoseRequest{
+		RequestID: "r2",
+		Records: []struct {
+			Data string `json:"data"`
+		}{
+			{Data: goodRecord},
+			{Data: "not-valid-base64!!"},
+		},
+	})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set(firehoseAccessKeyHeader, "correct-secret")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var fr firehoseResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&fr))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "a partial failure should still be acked so good records aren't redelivered")
+	assert.NotEmpty(t, fr.ErrorMessage, "the response should surface that one record failed")
+
+	query := &cloudWatchQuery{Namespace: "AWS/EC2", MetricName: "CPUUtilization", Stats: "Sum",
+		Dimensions: map[string][]string{"InstanceId": {"i-0123abcd"}}}
+	frame := e.queryStreamingBuffer(query)
+	require.NotNil(t, frame, "the good record should have been buffered despite the bad one failing")
+	assert.Equal(t, 1, frame.Fields[0].Len())
+}
+
+func TestMetricStreamsHandler_AllRecordsFailingReturnsServerError(t *testing.T) {
+	e := newTestMetricStreamsExecutor("correct-secret")
+	srv := httptest.NewServer(e.MetricStreamsHandler())
+	defer srv.Close()
+
+	body, err := json.Marshal(firehoseRequest{
+		RequestID: "r3",
+		Records: []struct {
+			Data string `json:"data"`
+		}{{Data: "not-valid-base64!!"}},
+	})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(string(body)))
+	require.NoError(t, err)
+	req.Header.Set(firehoseAccessKeyHeader, "correct-secret")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+func TestStreamBufferKey_IsDeterministicRegardlessOfDimensionMapIterationOrder(t *testing.T) {
+	dims := map[string][]string{"InstanceId": {"i-1"}, "AutoScalingGroupName": {"asg-1"}, "AvailabilityZone": {"us-east-1a"}}
+	want := streamBufferKey("AWS/EC2", "CPUUtilization", dims, "Sum")
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, want, streamBufferKey("AWS/EC2", "CPUUtilization", dims, "Sum"),
+			"the key must not depend on Go's randomized map iteration order")
+	}
+}
+
+// panicsIfCalledCWClient fails the test if any GetMetricData call reaches
+// it, proving a streamingSource query never hits the AWS API.
+type panicsIfCalledCWClient struct {
+	cloudwatchiface.CloudWatchAPI
+	t *testing.T
+}
+
+func (c *panicsIfCalledCWClient) GetMetricDataWithContext(aws.Context, *cloudwatch.GetMetricDataInput, ...request.Option) (*cloudwatch.GetMetricDataOutput, error) {
+	c.t.Fatal("GetMetricData should never be called for a streamingSource query")
+	return nil, nil
+}
+
+func TestExecuteMetricDataBatches_ServesStreamingSourceQueryFromBufferWithoutCallingAWS(t *testing.T) {
+	e := newTestMetricStreamsExecutor("correct-secret")
+	dims := map[string][]string{"InstanceId": {"i-0123abcd"}}
+	e.metricStreams.bufferFor(streamBufferKey("AWS/EC2", "CPUUtilization", dims, "Sum")).add(streamPoint{
+		timestampMillis: 1_600_000_000_000,
+		value:           42,
+	})
+
+	query := &cloudWatchQuery{
+		Id: "id", RefId: "A", Namespace: "AWS/EC2", MetricName: "CPUUtilization", Stats: "Sum",
+		Dimensions: dims, StreamingSource: true,
+	}
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	responses, err := e.executeMetricDataBatches(context.Background(), &panicsIfCalledCWClient{t: t}, map[string]*cloudWatchQuery{"id": query}, start, end, time.Second)
+	require.NoError(t, err)
+	require.Len(t, responses, 1)
+	require.Len(t, responses[0].DataFrames, 1)
+	assert.Equal(t, 1, responses[0].DataFrames[0].Fields[0].Len())
+}
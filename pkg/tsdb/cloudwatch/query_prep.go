@@ -0,0 +1,40 @@
+package cloudwatch
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+// prepareTimeSeriesQuery finalizes a cloudWatchQuery immediately before
+// it's sent to GetMetricData, applying any request-shaping options parsed
+// off the query (dataGranularity, ...). Callers that build a
+// GetMetricDataInput should run each query through this first.
+func (e *cloudWatchExecutor) prepareTimeSeriesQuery(query *cloudWatchQuery) *cloudWatchQuery {
+	prepareGranularityQuery(query)
+	return query
+}
+
+// buildMetricDataInput finalizes query and builds the GetMetricDataInput
+// to send to GetMetricData, branching on whether it's a Metrics Insights
+// (SQL) query — which requires passing validateInsightsQuery and sends a
+// bare Expression with no MetricStat block — or a regular metric stat
+// query.
+func (e *cloudWatchExecutor) buildMetricDataInput(query *cloudWatchQuery, startTime, endTime time.Time) (*cloudwatch.GetMetricDataInput, error) {
+	e.prepareTimeSeriesQuery(query)
+
+	if isInsightsQuery(query) {
+		dataQuery, err := buildInsightsMetricDataQuery(query)
+		if err != nil {
+			return nil, err
+		}
+		return &cloudwatch.GetMetricDataInput{
+			StartTime:         aws.Time(startTime),
+			EndTime:           aws.Time(endTime),
+			MetricDataQueries: []*cloudwatch.MetricDataQuery{dataQuery},
+		}, nil
+	}
+
+	return buildGetMetricDataInput(query, startTime, endTime), nil
+}
@@ -2,6 +2,7 @@ package cloudwatch
 
 import (
 	"fmt"
+	"log/slog"
 	"sort"
 	"strconv"
 	"strings"
@@ -13,7 +14,7 @@ import (
 
 func (e *cloudWatchExecutor) parseResponse(metricDataOutputs []*cloudwatch.GetMetricDataOutput,
 	queries map[string]*cloudWatchQuery) ([]*cloudwatchResponse, error) {
-	plog.Debug("Parsing metric data output", "queries", queries)
+	e.logger().Debug("Parsing metric data output", slog.Int("queryCount", len(queries)))
 	mdr := make(map[string]map[string]*cloudwatch.MetricDataResult)
 	for _, mdo := range metricDataOutputs {
 		requestExceededMaxLimit := false
@@ -42,8 +43,9 @@ func (e *cloudWatchExecutor) parseResponse(metricDataOutputs []*cloudwatch.GetMe
 
 	cloudWatchResponses := make([]*cloudwatchResponse, 0)
 	for id, lr := range mdr {
-		plog.Debug("Handling metric data results", "id", id, "lr", lr)
-		frames, partialData, err := parseGetMetricDataTimeSeries(lr, queries[id])
+		logger := queryLogger(e.logger(), queries[id].RefId)
+		logger.Debug("Handling metric data results", slog.String("id", id), slog.Int("labelCount", len(lr)))
+		frames, partialData, granularityMeta, err := parseGetMetricDataTimeSeries(logger, lr, queries[id])
 		if err != nil {
 			return nil, err
 		}
@@ -56,6 +58,7 @@ func (e *cloudWatchExecutor) parseResponse(metricDataOutputs []*cloudwatch.GetMe
 			Id:                      queries[id].Id,
 			RequestExceededMaxLimit: queries[id].RequestExceededMaxLimit,
 			PartialData:             partialData,
+			GranularityMeta:         granularityMeta,
 		}
 		cloudWatchResponses = append(cloudWatchResponses, response)
 	}
@@ -63,30 +66,31 @@ func (e *cloudWatchExecutor) parseResponse(metricDataOutputs []*cloudwatch.GetMe
 	return cloudWatchResponses, nil
 }
 
-func parseGetMetricDataTimeSeries(metricDataResults map[string]*cloudwatch.MetricDataResult,
-	query *cloudWatchQuery) (data.Frames, bool, error) {
-	plog.Debug("Parsing metric data results", "results", metricDataResults)
+func parseGetMetricDataTimeSeries(logger *slog.Logger, metricDataResults map[string]*cloudwatch.MetricDataResult,
+	query *cloudWatchQuery) (data.Frames, bool, *dataGranularityMeta, error) {
 	metricDataResultLabels := make([]string, 0)
 	for k := range metricDataResults {
 		metricDataResultLabels = append(metricDataResultLabels, k)
 	}
 	sort.Strings(metricDataResultLabels)
 
-	plog.Debug("Metric data result labels", "labels", metricDataResultLabels)
+	logger.Debug("Parsing metric data results", slog.Int("labelCount", len(metricDataResultLabels)))
 
 	partialData := false
 	frames := data.Frames{}
+	apiDatapoints := 0
+	denseDatapoints := 0
 	for _, label := range metricDataResultLabels {
 		metricDataResult := metricDataResults[label]
-		plog.Debug("Processing metric data result", "label", label, "statusCode", metricDataResult.StatusCode)
+		logger.Debug("Processing metric data result", slog.String("label", label), slog.String("statusCode", *metricDataResult.StatusCode))
 		if *metricDataResult.StatusCode != "Complete" {
-			plog.Debug("Handling a partial result")
+			logger.Debug("Handling a partial result")
 			partialData = true
 		}
 
 		for _, message := range metricDataResult.Messages {
 			if *message.Code == "ArithmeticError" {
-				return nil, false, fmt.Errorf("ArithmeticError in query %q: %s", query.RefId, *message.Value)
+				return nil, false, nil, fmt.Errorf("ArithmeticError in query %q: %s", query.RefId, *message.Value)
 			}
 		}
 
@@ -111,7 +115,7 @@ func parseGetMetricDataTimeSeries(metricDataResults map[string]*cloudwatch.Metri
 				}
 
 				emptyFrame := data.Frame{
-					Name: formatAlias(query, query.Stats, tags, label),
+					Name: formatAlias(logger, query, query.Stats, tags, label),
 					Meta: &data.FrameMeta{
 						Custom: map[string]interface{}{
 							"tags": tags,
@@ -121,27 +125,33 @@ func parseGetMetricDataTimeSeries(metricDataResults map[string]*cloudwatch.Metri
 				frames = append(frames, &emptyFrame)
 			}
 		} else {
-			dims := make([]string, 0, len(query.Dimensions))
-			for k := range query.Dimensions {
-				dims = append(dims, k)
-			}
-			sort.Strings(dims)
-
-			tags := map[string]string{}
-			for _, dim := range dims {
-				plog.Debug("Handling dimension", "dimension", dim)
-				values := query.Dimensions[dim]
-				if len(values) == 1 && values[0] != "*" {
-					plog.Debug("Got a tag value", "tag", dim, "value", values[0])
-					tags[dim] = values[0]
-				} else {
-					for _, value := range values {
-						if value == label || value == "*" {
-							plog.Debug("Got a tag value", "tag", dim, "value", value, "label", label)
-							tags[dim] = label
-						} else if strings.Contains(label, value) {
-							plog.Debug("Got a tag value", "tag", dim, "value", value, "label", label)
-							tags[dim] = value
+			var tags map[string]string
+			if isInsightsQuery(query) {
+				tags = insightsTagsFromLabel(parseInsightsGroupByColumns(query.Expression), label)
+				logger.Debug("Derived tags from Insights label", slog.String("label", label), slog.Any("tags", tags))
+			} else {
+				dims := make([]string, 0, len(query.Dimensions))
+				for k := range query.Dimensions {
+					dims = append(dims, k)
+				}
+				sort.Strings(dims)
+
+				tags = map[string]string{}
+				for _, dim := range dims {
+					logger.Debug("Handling dimension", slog.String("dimension", dim))
+					values := query.Dimensions[dim]
+					if len(values) == 1 && values[0] != "*" {
+						logger.Debug("Got a tag value", slog.String("tag", dim), slog.String("value", values[0]))
+						tags[dim] = values[0]
+					} else {
+						for _, value := range values {
+							if value == label || value == "*" {
+								logger.Debug("Got a tag value", slog.String("tag", dim), slog.String("value", value), slog.String("label", label))
+								tags[dim] = label
+							} else if strings.Contains(label, value) {
+								logger.Debug("Got a tag value", slog.String("tag", dim), slog.String("value", value), slog.String("label", label))
+								tags[dim] = value
+							}
 						}
 					}
 				}
@@ -158,17 +168,26 @@ func parseGetMetricDataTimeSeries(metricDataResults map[string]*cloudwatch.Metri
 					}
 				}
 				val := metricDataResult.Values[j]
-				plog.Debug("Handling timestamp", "timestamp", t, "value", *val)
+				logger.Debug("Handling timestamp", slog.Time("timestamp", *t), slog.Float64("value", *val))
 				timestamps = append(timestamps, float64(t.Unix()*1000))
 				points = append(points, val)
 			}
 
+			if query.DataGranularity > 0 && query.PanelPeriod > 0 && query.PanelPeriod < query.Period {
+				apiDatapoints += len(timestamps)
+				timestamps, points = interpolateToStep(timestamps, points,
+					int64(query.Period)*1000, int64(query.PanelPeriod)*1000)
+				denseDatapoints += len(timestamps)
+				logger.Debug("Interpolated datapoints for dataGranularity",
+					slog.Int("period", query.Period), slog.Int("panelPeriod", query.PanelPeriod))
+			}
+
 			fields := []*data.Field{
 				data.NewField("timestamp", nil, timestamps),
 				data.NewField("value", nil, points),
 			}
 			frame := data.Frame{
-				Name:   formatAlias(query, query.Stats, tags, label),
+				Name:   formatAlias(logger, query, query.Stats, tags, label),
 				Fields: fields,
 				Meta: &data.FrameMeta{
 					Custom: map[string]interface{}{
@@ -180,10 +199,15 @@ func parseGetMetricDataTimeSeries(metricDataResults map[string]*cloudwatch.Metri
 		}
 	}
 
-	return frames, partialData, nil
+	var granularityMeta *dataGranularityMeta
+	if query.DataGranularity > 0 && query.PanelPeriod > 0 && query.PanelPeriod < query.Period {
+		granularityMeta = granularityMetaFor(query.Period, apiDatapoints, denseDatapoints)
+	}
+
+	return frames, partialData, granularityMeta, nil
 }
 
-func formatAlias(query *cloudWatchQuery, stat string, dimensions map[string]string, label string) string {
+func formatAlias(logger *slog.Logger, query *cloudWatchQuery, stat string, dimensions map[string]string, label string) string {
 	region := query.Region
 	namespace := query.Namespace
 	metricName := query.MetricName
@@ -196,6 +220,9 @@ func formatAlias(query *cloudWatchQuery, stat string, dimensions map[string]stri
 		stat = strings.Trim(query.Expression[sIndex+1:pIndex], " '")
 	}
 
+	if len(query.Alias) == 0 && isInsightsQuery(query) {
+		return label
+	}
 	if len(query.Alias) == 0 && query.isMathExpression() {
 		return query.Id
 	}
@@ -229,6 +256,7 @@ func formatAlias(query *cloudWatchQuery, stat string, dimensions map[string]stri
 	})
 
 	if string(result) == "" {
+		logger.Debug("Alias pattern resolved to an empty string, falling back to metric_stat", slog.String("alias", query.Alias))
 		return metricName + "_" + stat
 	}
 
@@ -21,6 +21,13 @@ type requestQuery struct {
 	Period             int
 	Alias              string
 	MatchExact         bool
+	StreamingSource    bool
+	DataGranularity    int
+	QueryMode          string
+	// PanelPeriod is the period Grafana's panel actually requested, stashed
+	// here by prepareGranularityQuery before Period is rounded up to
+	// DataGranularity, so the response can be interpolated back down to it.
+	PanelPeriod int
 }
 
 type cloudwatchResponse struct {
@@ -31,6 +38,24 @@ type cloudwatchResponse struct {
 	RequestExceededMaxLimit bool
 	PartialData             bool
 	Period                  int
+	GranularityMeta         *dataGranularityMeta
+	// DeadlineExceeded is set when the query's soft deadline elapsed
+	// before every GetMetricData batch had completed, so the frontend can
+	// render a "partial" badge instead of the panel silently showing
+	// incomplete data.
+	DeadlineExceeded bool
+	FramesReturned   int
+	FramesTimedOut   int
+}
+
+// dataGranularityMeta is surfaced on the query result's Meta field when
+// dataGranularity rounded the requested period up to reduce the number of
+// datapoints fetched from GetMetricData. DatapointsSavedRatio is the
+// fraction of datapoints the panel would otherwise have requested from the
+// CloudWatch API that were instead produced locally via interpolation.
+type dataGranularityMeta struct {
+	EffectivePeriod      int     `json:"effectivePeriod"`
+	DatapointsSavedRatio float64 `json:"datapointsSavedRatio"`
 }
 
 type queryError struct {